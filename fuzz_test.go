@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// FuzzDecodeArchive seeds from a small corpus of valid archives (see
+// testdata/corpus) and then mutates them byte-by-byte, in the style of
+// archive/zip's FuzzReader. decodeContent used to swallow base64 and
+// out-of-range-offset errors and silently truncate the pipe instead of
+// propagating them, so a malformed archive could produce truncated files
+// without Decode ever returning an error. The only property checked here is
+// that Decode never panics and never hangs on corrupted input; a non-nil
+// error is an expected, correct outcome for mutated bytes. This fuzz
+// property alone can't catch wrong-but-non-panicking output (see
+// TestEncodeDecodeRoundTripCommaContent for that correctness check on the
+// valid, unmutated seeds).
+func FuzzDecodeArchive(f *testing.F) {
+	entries, err := os.ReadDir("testdata/corpus")
+	if err != nil {
+		f.Fatalf("reading corpus: %v", err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join("testdata/corpus", e.Name()))
+		if err != nil {
+			f.Fatalf("reading seed %s: %v", e.Name(), err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fs := afero.NewMemMapFs()
+		_ = Decode(bytes.NewReader(data), fs, "out")
+	})
+}
@@ -2,16 +2,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
 	_ "embed"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
+
+	"github.com/spf13/afero"
 )
 
 const (
@@ -21,36 +27,101 @@ const (
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: minall folder_path")
+	args := os.Args[1:]
+	if len(args) < 1 {
+		fmt.Println("Usage: minall folder_path|archive.zip [-qr]")
+		fmt.Println("       minall -d archive.html [destDir] [-o zip]")
+		fmt.Println("       minall -scan ocr.txt qrcodes.txt [destDir]")
 		return
 	}
-	dirPath := &(os.Args[1])
-	//dirPath := flag.String("dir", "", "Path to the input or output directory")
-	outputPath := "outfile.html"
-	decompress := ""
-	if os.Args[1] == "-d" {
-		decompress = os.Args[2]
+
+	osFs := afero.NewOsFs()
+
+	if args[0] == "-scan" {
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: -scan requires an OCR text file and a QR payload file")
+			os.Exit(1)
+		}
+		ocrFile, err := os.Open(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening OCR text file: %v\n", err)
+			os.Exit(1)
+		}
+		defer ocrFile.Close()
+		qrFile, err := os.Open(args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening QR payload file: %v\n", err)
+			os.Exit(1)
+		}
+		defer qrFile.Close()
+		dest := "."
+		if len(args) > 3 {
+			dest = args[3]
+		}
+		qrPayloads, err := ParseScannedQRPayloads(qrFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing QR payloads: %v\n", err)
+			os.Exit(1)
+		}
+		if err := decodeScannedPDF(ocrFile, qrPayloads, &dirSink{fs: osFs, baseDir: dest}); err != nil {
+			fmt.Fprintf(os.Stderr, "Decoding error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
-	html := true
 
-	if decompress != "" {
+	if args[0] == "-d" {
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: -d requires an archive path")
+			os.Exit(1)
+		}
+		decompress := args[1]
+		dest := "."
+		outZip := false
+		for i := 2; i < len(args); i++ {
+			if args[i] == "-o" && i+1 < len(args) {
+				outZip = args[i+1] == "zip"
+				i++
+				continue
+			}
+			dest = args[i]
+		}
+
 		f, err := os.Open(decompress)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening input file: %v\n", err)
 			os.Exit(1)
 		}
 		defer f.Close()
-		if err := decodeArchive(f, *dirPath); err != nil {
+
+		if outZip {
+			out, err := os.Create(dest)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output zip: %v\n", err)
+				os.Exit(1)
+			}
+			defer out.Close()
+			if err := DecodeZip(f, out); err != nil {
+				fmt.Fprintf(os.Stderr, "Decoding error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if err := Decode(f, osFs, dest); err != nil {
 			fmt.Fprintf(os.Stderr, "Decoding error: %v\n", err)
 			os.Exit(1)
 		}
 		return
 	}
 
-	if *dirPath == "" {
-		fmt.Fprintln(os.Stderr, "Error: input directory path required. Use -dir <directory>")
-		os.Exit(1)
+	dirPath := args[0]
+	outputPath := "outfile.html"
+	html := true
+	qrFallback := false
+	for _, a := range args[1:] {
+		if a == "-qr" {
+			qrFallback = true
+		}
 	}
 
 	f, err := os.Create(outputPath)
@@ -65,7 +136,7 @@ func main() {
 		r, w := io.Pipe()
 		wg := &sync.WaitGroup{}
 		wg.Add(1)
-		go makeHTML(flow, r, wg)
+		go makeHTMLWithOptions(flow, r, wg, HTMLOptions{QRFallback: qrFallback})
 		flow = w
 		defer func() {
 			r.Close()
@@ -73,7 +144,11 @@ func main() {
 		}()
 	}
 
-	err = walkAndEncode(*dirPath, flow)
+	if strings.HasSuffix(strings.ToLower(dirPath), ".zip") {
+		err = EncodeZip(dirPath, flow)
+	} else {
+		err = Encode(osFs, dirPath, flow)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Encoding error: %v\n", err)
 		os.Exit(1)
@@ -94,9 +169,55 @@ func DJB2(data []byte) uint32 {
 	return hash
 }
 
-func decodeArchive(r io.Reader, baseDir string) error {
+// FileVerifyError reports that a decoded file failed to match the metadata
+// recorded for it at encode time, e.g. because an OCR scan mangled a page.
+type FileVerifyError struct {
+	Path   string
+	Reason string
+}
+
+func (e *FileVerifyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// Decode reads an encoded archive from r and restores it under baseDir on fs.
+// fs may be an afero.NewOsFs() for real restores, an afero.NewMemMapFs() for
+// tests, or any other afero.Fs (e.g. a BasePathFs for sandboxed extraction).
+func Decode(r io.Reader, fs afero.Fs, baseDir string) error {
+	return decodeToSink(r, &dirSink{fs: fs, baseDir: baseDir})
+}
+
+// decodeToSink reads an encoded archive from r and replays it into sink one
+// directory/file at a time.
+//
+// Each file's length, DJB2 hash, and whole-archive manifest digest are
+// verified against the values recorded at encode time; mismatches are
+// collected into a *FileVerifyError per file (rather than aborting the
+// restore) so a user can tell which pages of a scanned archive need to be
+// re-scanned. The mtime and mode recorded for each file are threaded
+// through to the sink for restoration. sink.Close() is always attempted,
+// even when the scan itself fails partway through, so a Sink like zipSink
+// still flushes whatever it already has.
+func decodeToSink(r io.Reader, sink Sink) error {
+	var failures []error
+	if err := scanArchiveTokens(r, sink, &failures); err != nil {
+		failures = append(failures, err)
+	}
+	if err := sink.Close(); err != nil {
+		failures = append(failures, err)
+	}
+	return errors.Join(failures...)
+}
+
+// scanArchiveTokens does the actual token-by-token replay for decodeToSink.
+// It returns early on the first malformed/unexpected token; verification
+// mismatches for an otherwise well-formed file are appended to *failures
+// instead, so a user can tell which pages of a scanned archive need to be
+// re-scanned.
+func scanArchiveTokens(r io.Reader, sink Sink, failures *[]error) error {
 	scanner := bufio.NewScanner(r)
 	scanner.Split(splitComma)
+	manifest := sha256.New()
 	for scanner.Scan() {
 		tok := scanner.Text()
 		if tok == "" {
@@ -107,37 +228,85 @@ func decodeArchive(r io.Reader, baseDir string) error {
 			if !scanner.Scan() {
 				return fmt.Errorf("expected directory name")
 			}
-			dir := filepath.Join(baseDir, unescapeCommas(scanner.Text()))
-			if err := os.MkdirAll(dir, 0755); err != nil {
+			dir := unescapeCommas(scanner.Text())
+			if !scanner.Scan() {
+				return fmt.Errorf("expected directory mode for %s", dir)
+			}
+			mode, err := parseFileMode(scanner.Text())
+			if err != nil {
+				return fmt.Errorf("invalid mode for %s: %v", dir, err)
+			}
+			if err := sink.Put(dir, os.ModeDir|mode, time.Time{}, nil); err != nil {
 				return fmt.Errorf("creating directory %s: %v", dir, err)
 			}
 		case "F":
 			if !scanner.Scan() {
 				return fmt.Errorf("expected file name")
 			}
-			filename := filepath.Join(baseDir, unescapeCommas(scanner.Text()))
-			if !scanner.Scan() || !scanner.Scan() || !scanner.Scan() {
-				return fmt.Errorf("expected file metadata")
-			}
+			relPath := unescapeCommas(scanner.Text())
+
 			if !scanner.Scan() {
-				return fmt.Errorf("expected rune length")
+				return fmt.Errorf("expected file mode for %s", relPath)
 			}
-			runelen, err := strconv.Atoi(scanner.Text())
+			mode, err := parseFileMode(scanner.Text())
 			if err != nil {
-				return fmt.Errorf("invalid rune length")
+				return fmt.Errorf("invalid mode for %s: %v", relPath, err)
+			}
+			if !scanner.Scan() {
+				return fmt.Errorf("expected file length")
+			}
+			wantLen, err := strconv.ParseInt(scanner.Text(), 10, 64)
+			if err != nil || wantLen < 0 {
+				return fmt.Errorf("invalid file length for %s", relPath)
 			}
-			f, err := os.Create(filename)
+			if !scanner.Scan() {
+				return fmt.Errorf("expected file timestamp")
+			}
+			mtime, err := time.Parse("2006-01-02", scanner.Text())
 			if err != nil {
-				return fmt.Errorf("creating file %s: %v", filename, err)
+				return fmt.Errorf("invalid timestamp for %s", relPath)
+			}
+			if !scanner.Scan() {
+				return fmt.Errorf("expected file hash")
 			}
-			dec := bufio.NewWriter(f)
+			wantHash := scanner.Text()
+
+			if !scanner.Scan() {
+				return fmt.Errorf("expected rune length")
+			}
+			runelen, err := strconv.Atoi(scanner.Text())
+			if err != nil || runelen < 0 {
+				return fmt.Errorf("invalid rune length for %s", relPath)
+			}
+
+			var content bytes.Buffer
+			djb2 := &djb2Writer{hash: 5381}
+			counter := &countingWriter{}
 			rdr := decodeContent(scanner, runelen)
-			if _, err := io.Copy(dec, rdr); err != nil {
-				f.Close()
-				return fmt.Errorf("writing decoded content: %v", err)
+			if _, err := io.Copy(io.MultiWriter(&content, djb2, counter), rdr); err != nil {
+				return fmt.Errorf("decoding content for %s: %v", relPath, err)
+			}
+			data := content.Bytes()
+
+			if counter.n != wantLen {
+				*failures = append(*failures, &FileVerifyError{relPath, fmt.Sprintf("decoded length %d != recorded length %d", counter.n, wantLen)})
+			}
+			if gotHash := fmt.Sprintf("%x", djb2.hash); gotHash != wantHash {
+				*failures = append(*failures, &FileVerifyError{relPath, fmt.Sprintf("DJB2 hash %s != recorded hash %s", gotHash, wantHash)})
+			}
+			if err := sink.Put(relPath, mode, mtime, data); err != nil {
+				*failures = append(*failures, &FileVerifyError{relPath, fmt.Sprintf("restoring file: %v", err)})
+			}
+
+			fmt.Fprintf(manifest, "%s\x00%d\x00%o\x00%x\n", relPath, len(data), mode, sha256.Sum256(data))
+		case "M":
+			if !scanner.Scan() {
+				return fmt.Errorf("expected manifest digest")
+			}
+			wantDigest := scanner.Text()
+			if gotDigest := hex.EncodeToString(manifest.Sum(nil)); gotDigest != wantDigest {
+				*failures = append(*failures, &FileVerifyError{"<archive>", fmt.Sprintf("manifest digest %s != recorded digest %s", gotDigest, wantDigest)})
 			}
-			dec.Flush()
-			f.Close()
 		default:
 			return fmt.Errorf("unexpected token %q", tok)
 		}
@@ -145,6 +314,38 @@ func decodeArchive(r io.Reader, baseDir string) error {
 	return scanner.Err()
 }
 
+// parseFileMode parses the octal permission string (e.g. "0644") recorded
+// for a D/F record back into an os.FileMode's permission bits.
+func parseFileMode(s string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(v), nil
+}
+
+// djb2Writer accumulates the DJB2 hash of every byte written to it.
+type djb2Writer struct {
+	hash uint32
+}
+
+func (d *djb2Writer) Write(p []byte) (int, error) {
+	for _, b := range p {
+		d.hash = ((d.hash << 5) + d.hash) + uint32(b)
+	}
+	return len(p), nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
 func splitComma(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	for i := 0; i < len(data); i++ {
 		if data[i] == ',' {
@@ -161,82 +362,170 @@ func unescapeCommas(s string) string {
 	return strings.ReplaceAll(s, "\\,", ",")
 }
 
+// wholeFileBase64Prefix marks a file that encodeData wrote out as a single
+// base64 blob (the >10% unprintable-bytes case) rather than as mixed
+// printable runes and inline ⌘ escapes.
+const wholeFileBase64Prefix = "base64:"
+
+// decodeContent reassembles a file's content from one or more
+// splitComma-delimited scanner tokens, stopping once it has written runelen
+// runes to the returned reader. A file's printable content can itself
+// contain literal commas, which splitComma treats as delimiters rather than
+// content bytes; decodeContent reinserts the comma swallowed between such
+// chunks the same way scanArchiveContent (qr.go) does for the HTML path, so
+// a chunk boundary mid-file doesn't desync the rest of the token stream.
 func decodeContent(scanner *bufio.Scanner, runelen int) io.Reader {
 	pr, pw := io.Pipe()
 	go func() {
 		defer pw.Close()
 		runesWritten := 0
+		first := true
 
 		for runesWritten < runelen && scanner.Scan() {
 			chunk := scanner.Text()
-			i := 0
-			for i < len(chunk) && runesWritten < runelen {
-				if chunk[i] == UnprintableReplacement[0] {
-					j := i + 1
-					for j < len(chunk) && chunk[j] >= '0' && chunk[j] <= '9' {
-						j++
-					}
-					if j >= len(chunk) || chunk[j] != ':' {
-						return
-					}
-					size, _ := strconv.Atoi(chunk[i+1 : j])
-					j++
-					if j+size > len(chunk) {
+			if first {
+				first = false
+				if runelen >= len(wholeFileBase64Prefix) && strings.HasPrefix(chunk, wholeFileBase64Prefix) {
+					decoded, err := base64.StdEncoding.DecodeString(chunk[len(wholeFileBase64Prefix):])
+					if err != nil {
+						pw.CloseWithError(fmt.Errorf("invalid whole-file base64 content: %v", err))
 						return
 					}
-					base64data := chunk[j : j+size]
-					decoded, _ := base64.StdEncoding.DecodeString(base64data)
 					pw.Write(decoded)
-					i = j + size
-					runesWritten += utf8.RuneCount(decoded)
-				} else if chunk[i] == NewlineReplacement[0] {
-					pw.Write([]byte{'\n'})
-					i++
-					runesWritten++
-				} else if chunk[i] == TabReplacement[0] {
-					pw.Write([]byte{'\t'})
-					i++
-					runesWritten++
-				} else {
-					r, size := utf8.DecodeRuneInString(chunk[i:])
-					buf := make([]byte, utf8.RuneLen(r))
-					utf8.EncodeRune(buf, r)
-					pw.Write(buf)
-					i += size
-					runesWritten++
+					return
+				}
+			} else {
+				if _, err := pw.Write([]byte{','}); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				runesWritten++
+				if runesWritten >= runelen {
+					break
 				}
 			}
+			n, err := decodeChunk(chunk, runelen-runesWritten, pw)
+			runesWritten += n
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if runesWritten < runelen {
+			pw.CloseWithError(fmt.Errorf("content ended after %d runes, expected %d", runesWritten, runelen))
 		}
 	}()
 	return pr
 }
 
-// //////////////
-func walkAndEncode(root string, w io.Writer) error {
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		relPath, _ := filepath.Rel(root, path)
-		if info.IsDir() {
-			if relPath != "." {
-				_, err := fmt.Fprintf(w, "D,%s", escapeCommas(relPath))
-				if err != nil {
-					return err
-				}
+// decodeChunk writes the decoded bytes for up to `remaining` runes of chunk
+// to pw and returns how many runes it consumed. It never consumes more runes
+// than `remaining`, and returns an error (rather than silently truncating)
+// on any malformed escape sequence or out-of-range offset.
+func decodeChunk(chunk string, remaining int, pw *io.PipeWriter) (int, error) {
+	written := 0
+	i := 0
+	for i < len(chunk) && written < remaining {
+		switch {
+		case hasMarkerAt(chunk, i, UnprintableReplacement):
+			j := i + len(UnprintableReplacement)
+			start := j
+			for j < len(chunk) && chunk[j] >= '0' && chunk[j] <= '9' {
+				j++
+			}
+			if j == start || j >= len(chunk) || chunk[j] != ':' {
+				return written, fmt.Errorf("malformed unprintable-run marker at offset %d", i)
+			}
+			size, err := strconv.Atoi(chunk[start:j])
+			if err != nil {
+				return written, fmt.Errorf("invalid unprintable-run size at offset %d: %v", i, err)
+			}
+			j++
+			if size < 0 || j+size > len(chunk) {
+				return written, fmt.Errorf("unprintable-run at offset %d overruns its chunk", i)
+			}
+			decoded, err := base64.StdEncoding.DecodeString(chunk[j : j+size])
+			if err != nil {
+				return written, fmt.Errorf("invalid base64 in unprintable run at offset %d: %v", i, err)
 			}
-			return nil
+			// markerRunes is the rune length of the marker's own encoded
+			// text (¶/→/⌘ char + digits + colon + base64), matching what
+			// runeCountingWriter counted at encode time -- not the rune
+			// count of the bytes it decodes to, which is a different number
+			// for any run that doesn't decode to all single-byte runes.
+			markerRunes := utf8.RuneCountInString(UnprintableReplacement) + (j - start) + size
+			if written+markerRunes > remaining {
+				return written, fmt.Errorf("unprintable run at offset %d overruns the declared content length", i)
+			}
+			if _, err := pw.Write(decoded); err != nil {
+				return written, err
+			}
+			i = j + size
+			written += markerRunes
+		case hasMarkerAt(chunk, i, NewlineReplacement):
+			if _, err := pw.Write([]byte{'\n'}); err != nil {
+				return written, err
+			}
+			i += len(NewlineReplacement)
+			written++
+		case hasMarkerAt(chunk, i, TabReplacement):
+			if _, err := pw.Write([]byte{'\t'}); err != nil {
+				return written, err
+			}
+			i += len(TabReplacement)
+			written++
+		default:
+			r, size := utf8.DecodeRuneInString(chunk[i:])
+			if r == utf8.RuneError && size <= 1 {
+				return written, fmt.Errorf("invalid UTF-8 at offset %d", i)
+			}
+			buf := make([]byte, utf8.RuneLen(r))
+			utf8.EncodeRune(buf, r)
+			if _, err := pw.Write(buf); err != nil {
+				return written, err
+			}
+			i += size
+			written++
 		}
+	}
+	return written, nil
+}
 
-		data, err := os.ReadFile(path)
-		if err != nil {
+// hasMarkerAt reports whether chunk contains the full multi-byte marker
+// sequence at offset i. Comparing only the leading byte (as earlier code
+// did) would false-positive on any byte sharing that leading byte with a
+// different, unrelated rune.
+func hasMarkerAt(chunk string, i int, marker string) bool {
+	return i+len(marker) <= len(chunk) && chunk[i:i+len(marker)] == marker
+}
+
+// //////////////
+
+// Encode walks root on fs and writes the text-archive encoding of every file
+// and directory under it to w. fs may be an afero.NewOsFs() for a real
+// folder, an afero.NewMemMapFs() for tests, or any other afero.Fs (a zip
+// mount, an HTTP-backed tree, etc.) that root resolves against.
+func Encode(fs afero.Fs, root string, w io.Writer) error {
+	return encodeFromSource(&dirSource{fs: fs, root: root}, w)
+}
+
+// encodeFromSource writes the text-archive encoding of every directory and
+// file src.Walk reports to w, trailed by an "M,<hex>" whole-archive digest
+// over a canonical (relPath, size, mode, sha256(content)) stream in walk
+// order.
+func encodeFromSource(src Source, w io.Writer) error {
+	manifest := sha256.New()
+
+	err := src.Walk(func(path string, mode os.FileMode, mtime time.Time, data []byte) error {
+		if mode.IsDir() {
+			_, err := fmt.Fprintf(w, "D,%s,%04o,", escapeCommas(path), mode.Perm())
 			return err
 		}
 
 		hash := DJB2(data)
 		shortHash := fmt.Sprintf("%x", hash)
-		timestamp := info.ModTime().UTC().Format("2006-01-02")
-		_, err = fmt.Fprintf(w, "F,%s,%d,%s,%s,", escapeCommas(relPath), len(data), timestamp, shortHash)
+		timestamp := mtime.UTC().Format("2006-01-02")
+		_, err := fmt.Fprintf(w, "F,%s,%04o,%d,%s,%s,", escapeCommas(path), mode.Perm(), len(data), timestamp, shortHash)
 		if err != nil {
 			return err
 		}
@@ -257,9 +546,20 @@ func walkAndEncode(root string, w io.Writer) error {
 		if err != nil {
 			return err
 		}
+		if _, err := fmt.Fprint(w, ","); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(manifest, "%s\x00%d\x00%o\x00%x\n", path, len(data), mode.Perm(), sha256.Sum256(data))
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "M,%s", hex.EncodeToString(manifest.Sum(nil)))
+	return err
 }
 
 type runeCountingWriter struct {
@@ -305,8 +605,11 @@ func encodeData(data []byte, w io.Writer) error {
 		if _, err := w.Write([]byte("base64:")); err != nil {
 			return err
 		}
-		_, err := base64.NewEncoder(base64.StdEncoding, w).Write(data)
-		return err
+		enc := base64.NewEncoder(base64.StdEncoding, w)
+		if _, err := enc.Write(data); err != nil {
+			return err
+		}
+		return enc.Close()
 	}
 
 	for _, b := range data {
@@ -349,8 +652,33 @@ func encodeData(data []byte, w io.Writer) error {
 //go:embed NotoSans-Regular.ttf
 var notoSansRegular []byte
 
+// HTMLOptions configures optional features of makeHTMLWithOptions's PDF/HTML
+// output.
+type HTMLOptions struct {
+	// QRFallback emits an inline SVG QR code alongside every base64
+	// whole-file record and every unprintable-run token at least QRThreshold
+	// bytes long, so a scanner can recover the bytes OCR mangles on the
+	// printed page. See decodeScannedPDF for the companion restore path.
+	QRFallback bool
+	// QRThreshold is the minimum decoded payload size, in bytes, that
+	// triggers a QR fallback block. Zero uses defaultQRThreshold.
+	QRThreshold int
+}
+
+const defaultQRThreshold = 64
+
+// makeHTML renders the archive stream from r as printable HTML, with no QR
+// fallback blocks.
 func makeHTML(out io.Writer, r *io.PipeReader, wg *sync.WaitGroup) {
+	makeHTMLWithOptions(out, r, wg, HTMLOptions{})
+}
+
+func makeHTMLWithOptions(out io.Writer, r *io.PipeReader, wg *sync.WaitGroup, opts HTMLOptions) {
 	defer wg.Done()
+	threshold := opts.QRThreshold
+	if threshold <= 0 {
+		threshold = defaultQRThreshold
+	}
 
 	// Write HTML header
 	fmt.Fprintf(out, `<!DOCTYPE html>
@@ -395,6 +723,14 @@ func makeHTML(out io.Writer, r *io.PipeReader, wg *sync.WaitGroup) {
             margin: 0.5in;
             position: relative;
         }
+        .qr-fallback {
+            display: inline-block;
+            margin: 2px 0;
+        }
+        .qr-fallback svg {
+            width: 0.75in;
+            height: 0.75in;
+        }
     </style>
 </head>
 <body>
@@ -402,24 +738,8 @@ func makeHTML(out io.Writer, r *io.PipeReader, wg *sync.WaitGroup) {
 <pre>A folder with arrow tabs, newlines, and base64-encoded non-ascii runs and whole-files with base64: prefix. Hash: h:=uint32(5381);for _,b:=range in {h=h*33+uint32(b)}
 `, base64.StdEncoding.EncodeToString(notoSansRegular))
 
-	var b [2048]byte
-	for {
-		data := b[:]
-		n, err := r.Read(data)
-		data = data[:n]
-		if n > 0 {
-			// Escape HTML special characters
-			escaped := strings.ReplaceAll(string(data), "&", "&amp;")
-			escaped = strings.ReplaceAll(escaped, "<", "&lt;")
-			escaped = strings.ReplaceAll(escaped, ">", "&gt;")
-			fmt.Fprint(out, escaped)
-		}
-		if err != nil {
-			if err != io.EOF {
-				fmt.Println("Err reading: " + err.Error())
-			}
-			break
-		}
+	if err := streamArchiveHTML(out, r, opts.QRFallback, threshold); err != nil {
+		fmt.Println("Err reading: " + err.Error())
 	}
 
 	// Write HTML footer
@@ -428,3 +748,108 @@ func makeHTML(out io.Writer, r *io.PipeReader, wg *sync.WaitGroup) {
 </body>
 </html>`)
 }
+
+// streamArchiveHTML copies the encoded archive text from r to out, HTML
+// escaping it, and (when qrFallback is set) interleaving inline SVG QR
+// fallback blocks for every base64 whole-file record and unprintable-run
+// token whose decoded payload is at least threshold bytes, tagged with the
+// owning file's rel-path and byte offset within its content field.
+func streamArchiveHTML(out io.Writer, r io.Reader, qrFallback bool, threshold int) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<24)
+	scanner.Split(splitComma)
+
+	echo := func(s string) { fmt.Fprint(out, htmlEscape(s)) }
+
+	for scanner.Scan() {
+		tok := scanner.Text()
+		if tok == "" {
+			continue
+		}
+		switch tok {
+		case "D":
+			echo("D,")
+			if !scanner.Scan() {
+				return fmt.Errorf("expected directory name")
+			}
+			echo(scanner.Text() + ",")
+			if !scanner.Scan() {
+				return fmt.Errorf("expected directory mode")
+			}
+			echo(scanner.Text() + ",")
+		case "F":
+			echo("F,")
+			if !scanner.Scan() {
+				return fmt.Errorf("expected file name")
+			}
+			relPath := scanner.Text()
+			echo(relPath + ",")
+			for i := 0; i < 4; i++ { // mode, length, timestamp, hash
+				if !scanner.Scan() {
+					return fmt.Errorf("expected file metadata for %s", relPath)
+				}
+				echo(scanner.Text() + ",")
+			}
+			if !scanner.Scan() {
+				return fmt.Errorf("expected rune length for %s", relPath)
+			}
+			runelenText := scanner.Text()
+			echo(runelenText + ",")
+			runelen, _ := strconv.Atoi(runelenText)
+
+			content, err := scanArchiveContent(scanner, runelen)
+			if err != nil {
+				return fmt.Errorf("streaming content for %s: %v", relPath, err)
+			}
+			echo(content + ",")
+
+			if qrFallback {
+				if err := writeQRFallbacks(out, relPath, content, threshold); err != nil {
+					return err
+				}
+			}
+		case "M":
+			echo("M,")
+			if !scanner.Scan() {
+				return fmt.Errorf("expected manifest digest")
+			}
+			echo(scanner.Text())
+		default:
+			return fmt.Errorf("unexpected token %q", tok)
+		}
+	}
+	return scanner.Err()
+}
+
+// scanArchiveContent reassembles a file's content field from one or more
+// comma-delimited scanner tokens (content can contain literal commas from
+// the original file bytes, which splitComma treats as delimiters), stopping
+// once it has accumulated runelen runes, matching the count encodeFromSource
+// recorded for this field.
+func scanArchiveContent(scanner *bufio.Scanner, runelen int) (string, error) {
+	var b strings.Builder
+	runes := 0
+	for runes < runelen {
+		if !scanner.Scan() {
+			return "", fmt.Errorf("content ended after %d runes, expected %d", runes, runelen)
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+			runes++
+		}
+		chunk := scanner.Text()
+		b.WriteString(chunk)
+		runes += utf8.RuneCountInString(chunk)
+	}
+	return b.String(), nil
+}
+
+// htmlEscape escapes the characters significant to both HTML text content
+// and double-quoted attribute values.
+func htmlEscape(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	s = strings.ReplaceAll(s, "\"", "&quot;")
+	return s
+}
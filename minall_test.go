@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	src := afero.NewMemMapFs()
+	afero.WriteFile(src, "root/a.txt", []byte("hello\nworld\t!"), 0644)
+	afero.WriteFile(src, "root/sub/b.bin", []byte{0, 1, 2, 3, 255, 254}, 0644)
+
+	var buf bytes.Buffer
+	if err := Encode(src, "root", &buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	dst := afero.NewMemMapFs()
+	if err := Decode(&buf, dst, "out"); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	got, err := afero.ReadFile(dst, "out/a.txt")
+	if err != nil || string(got) != "hello\nworld\t!" {
+		t.Fatalf("a.txt = %q, %v", got, err)
+	}
+	got, err = afero.ReadFile(dst, "out/sub/b.bin")
+	if err != nil || !bytes.Equal(got, []byte{0, 1, 2, 3, 255, 254}) {
+		t.Fatalf("sub/b.bin = %v, %v", got, err)
+	}
+}
+
+// TestDecodeInlineUnprintableRunFollowedByAnotherFile checks that a file
+// with an inline unprintable-run marker (below the 10% whole-file-base64
+// threshold) still leaves the token scanner in sync for whatever record
+// comes after it. decodeChunk's rune-budget bookkeeping must count the rune
+// length of the marker's own encoded text (⌘+digits+colon+base64), matching
+// what runeCountingWriter counted at encode time — not the rune count of the
+// bytes the marker decodes to, which desyncs every record after the first
+// unprintable run whose decoded bytes don't happen to be all single-rune.
+func TestDecodeInlineUnprintableRunFollowedByAnotherFile(t *testing.T) {
+	src := afero.NewMemMapFs()
+	data := append(bytes.Repeat([]byte("plain ascii text "), 20), []byte{0x01, 0x02, 0x03}...)
+	afero.WriteFile(src, "root/a.txt", data, 0644)
+	afero.WriteFile(src, "root/b.txt", []byte("second file"), 0644)
+
+	var buf bytes.Buffer
+	if err := Encode(src, "root", &buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	dst := afero.NewMemMapFs()
+	if err := Decode(&buf, dst, "out"); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	got, err := afero.ReadFile(dst, "out/a.txt")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("a.txt = %v, %v, want %v", got, err, data)
+	}
+	got, err = afero.ReadFile(dst, "out/b.txt")
+	if err != nil || string(got) != "second file" {
+		t.Fatalf("b.txt = %q, %v", got, err)
+	}
+}
+
+// TestEncodeDecodeRoundTripCommaContent checks that a file whose content
+// contains literal commas round-trips intact. splitComma treats every comma
+// as a token delimiter, including ones that are part of a file's printable
+// content rather than a field separator; decodeContent must reinsert the
+// delimiter it swallowed or the file (and every record after it) comes back
+// corrupted.
+func TestEncodeDecodeRoundTripCommaContent(t *testing.T) {
+	src := afero.NewMemMapFs()
+	afero.WriteFile(src, "root/a.txt", []byte("top level, with a comma"), 0644)
+	afero.WriteFile(src, "root/b.csv", []byte("a,b,c,d,e,f,g"), 0644)
+
+	var buf bytes.Buffer
+	if err := Encode(src, "root", &buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	dst := afero.NewMemMapFs()
+	if err := Decode(&buf, dst, "out"); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	got, err := afero.ReadFile(dst, "out/a.txt")
+	if err != nil || string(got) != "top level, with a comma" {
+		t.Fatalf("a.txt = %q, %v", got, err)
+	}
+	got, err = afero.ReadFile(dst, "out/b.csv")
+	if err != nil || string(got) != "a,b,c,d,e,f,g" {
+		t.Fatalf("b.csv = %q, %v", got, err)
+	}
+}
+
+func TestDecodeDetectsCorruption(t *testing.T) {
+	src := afero.NewMemMapFs()
+	afero.WriteFile(src, "root/a.txt", []byte("plain text file"), 0644)
+
+	var buf bytes.Buffer
+	if err := Encode(src, "root", &buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	corrupted := strings.Replace(buf.String(), "plain", "PLAIN", 1)
+
+	dst := afero.NewMemMapFs()
+	if err := Decode(strings.NewReader(corrupted), dst, "out"); err == nil {
+		t.Fatal("expected a verification error for corrupted content")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// qrChunkSize is the maximum number of base64 characters encoded into a
+// single QR code block; go-qrcode's byte-mode capacity tops out around 2,953
+// bytes, so larger payloads are split across several blocks rather than
+// failing to encode.
+const qrChunkSize = 1500
+
+// writeQRFallbacks emits an inline SVG QR fallback (see renderQRBlocks) for
+// content's base64 whole-file prefix or any unprintable-run marker within it
+// whose decoded size is at least threshold bytes.
+func writeQRFallbacks(out io.Writer, relPath, content string, threshold int) error {
+	if strings.HasPrefix(content, wholeFileBase64Prefix) {
+		payload := content[len(wholeFileBase64Prefix):]
+		if base64DecodedLen(len(payload)) >= threshold {
+			return renderQRBlocks(out, relPath, 0, payload)
+		}
+		return nil
+	}
+
+	i := 0
+	for i < len(content) {
+		if hasMarkerAt(content, i, UnprintableReplacement) {
+			j := i + len(UnprintableReplacement)
+			start := j
+			for j < len(content) && content[j] >= '0' && content[j] <= '9' {
+				j++
+			}
+			if j > start && j < len(content) && content[j] == ':' {
+				size, err := strconv.Atoi(content[start:j])
+				j++
+				if err == nil && size >= 0 && j+size <= len(content) {
+					if base64DecodedLen(size) >= threshold {
+						if err := renderQRBlocks(out, relPath, i, content[j:j+size]); err != nil {
+							return err
+						}
+					}
+					i = j + size
+					continue
+				}
+			}
+		}
+		_, sz := utf8.DecodeRuneInString(content[i:])
+		if sz == 0 {
+			sz = 1
+		}
+		i += sz
+	}
+	return nil
+}
+
+// renderQRBlocks writes one or more inline SVG QR codes encoding payload (a
+// base64 string already present in the archive text), tagged with the owning
+// file's rel-path and the byte offset of the marker within its content
+// field, so an external scanner can recover bytes OCR mangled on the page.
+func renderQRBlocks(out io.Writer, relPath string, offset int, payload string) error {
+	for i := 0; i < len(payload); i += qrChunkSize {
+		end := i + qrChunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		svg, err := qrSVG(payload[i:end])
+		if err != nil {
+			return fmt.Errorf("rendering QR fallback for %s@%d: %v", relPath, offset, err)
+		}
+		fmt.Fprintf(out, `</pre><div class="qr-fallback" data-path="%s" data-offset="%d" data-chunk-offset="%d">%s</div><pre>`,
+			htmlEscape(relPath), offset, i, svg)
+	}
+	return nil
+}
+
+// qrSVG renders content as a minimal inline SVG QR code: one <rect> per dark
+// module, with no XML declaration or external styling, so it drops straight
+// into the HTML makeHTMLWithOptions produces. go-qrcode only exposes PNG
+// encoding directly, so this draws the SVG itself from the code's bitmap.
+func qrSVG(content string) (string, error) {
+	q, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return "", err
+	}
+	bitmap := q.Bitmap()
+	size := len(bitmap)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d">`, size, size)
+	b.WriteString(`<rect width="100%" height="100%" fill="white"/>`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="1" height="1"/>`, x, y)
+			}
+		}
+	}
+	b.WriteString(`</svg>`)
+	return b.String(), nil
+}
+
+// base64DecodedLen estimates the number of decoded bytes a base64 string of
+// the given encoded length represents, for comparing against QRThreshold.
+func base64DecodedLen(encodedLen int) int {
+	return encodedLen * 3 / 4
+}
+
+// ScannedQRPayload is one QR code recovered from a printed archive by an
+// external scanner tool, tagged with the file and content-field byte offset
+// it replaces (see renderQRBlocks).
+type ScannedQRPayload struct {
+	Path   string
+	Offset int
+	Base64 string
+}
+
+// ParseScannedQRPayloads reads "path\toffset\tbase64\n" lines, as produced by
+// an external QR scanner run over a printed archive, into ScannedQRPayloads.
+func ParseScannedQRPayloads(r io.Reader) ([]ScannedQRPayload, error) {
+	var out []ScannedQRPayload
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("malformed scanned QR line %q", line)
+		}
+		offset, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in scanned QR line %q: %v", line, err)
+		}
+		out = append(out, ScannedQRPayload{Path: parts[0], Offset: offset, Base64: parts[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decodeScannedPDF reconstructs an archive from OCR'd text recovered from a
+// printed copy (see HTMLOptions.QRFallback) plus the QR codes printed
+// alongside the base64/sentinel runs OCR cannot read reliably. Every inline
+// base64 whole-file record or unprintable-run token is replaced with its
+// corresponding scanned QR payload when one was recovered for that (path,
+// offset); every other byte is trusted to the OCR'd text as-is, and
+// decodeToSink's usual length/hash verification still catches any OCR
+// corruption that wasn't covered by a QR code.
+func decodeScannedPDF(ocrText io.Reader, qrPayloads []ScannedQRPayload, sink Sink) error {
+	lookup := make(map[string]string, len(qrPayloads))
+	for _, p := range qrPayloads {
+		lookup[fmt.Sprintf("%s\x00%d", p.Path, p.Offset)] = p.Base64
+	}
+
+	var patched bytes.Buffer
+	scanner := bufio.NewScanner(ocrText)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<24)
+	scanner.Split(splitComma)
+
+	for scanner.Scan() {
+		tok := scanner.Text()
+		if tok == "" {
+			continue
+		}
+		switch tok {
+		case "D":
+			fmt.Fprint(&patched, "D,")
+			if !scanner.Scan() {
+				return fmt.Errorf("expected directory name")
+			}
+			fmt.Fprintf(&patched, "%s,", scanner.Text())
+			if !scanner.Scan() {
+				return fmt.Errorf("expected directory mode")
+			}
+			fmt.Fprintf(&patched, "%s,", scanner.Text())
+		case "F":
+			fmt.Fprint(&patched, "F,")
+			if !scanner.Scan() {
+				return fmt.Errorf("expected file name")
+			}
+			relPath := scanner.Text()
+			fmt.Fprintf(&patched, "%s,", relPath)
+			for i := 0; i < 4; i++ { // mode, length, timestamp, hash
+				if !scanner.Scan() {
+					return fmt.Errorf("expected file metadata for %s", relPath)
+				}
+				fmt.Fprintf(&patched, "%s,", scanner.Text())
+			}
+			if !scanner.Scan() {
+				return fmt.Errorf("expected rune length for %s", relPath)
+			}
+			runelen, _ := strconv.Atoi(scanner.Text())
+
+			content, err := scanArchiveContent(scanner, runelen)
+			if err != nil {
+				return fmt.Errorf("reading scanned content for %s: %v", relPath, err)
+			}
+			patchedContent, newRunelen := patchContentWithQR(relPath, content, lookup)
+			fmt.Fprintf(&patched, "%d,%s,", newRunelen, patchedContent)
+		case "M":
+			fmt.Fprint(&patched, "M,")
+			if !scanner.Scan() {
+				return fmt.Errorf("expected manifest digest")
+			}
+			fmt.Fprint(&patched, scanner.Text())
+		default:
+			return fmt.Errorf("unexpected token %q in scanned text", tok)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return decodeToSink(&patched, sink)
+}
+
+// patchContentWithQR replaces every base64 whole-file or unprintable-run
+// chunk in content with the scanned QR payload recovered for its
+// (relPath, offset), when one exists, and returns the patched content along
+// with its new rune count.
+func patchContentWithQR(relPath, content string, lookup map[string]string) (string, int) {
+	if strings.HasPrefix(content, wholeFileBase64Prefix) {
+		if repl, ok := lookup[fmt.Sprintf("%s\x00%d", relPath, 0)]; ok {
+			patched := wholeFileBase64Prefix + repl
+			return patched, utf8.RuneCountInString(patched)
+		}
+		return content, utf8.RuneCountInString(content)
+	}
+
+	var b strings.Builder
+	i := 0
+	for i < len(content) {
+		if hasMarkerAt(content, i, UnprintableReplacement) {
+			j := i + len(UnprintableReplacement)
+			start := j
+			for j < len(content) && content[j] >= '0' && content[j] <= '9' {
+				j++
+			}
+			if j > start && j < len(content) && content[j] == ':' {
+				declaredSize, err := strconv.Atoi(content[start:j])
+				j++
+				if err == nil && declaredSize >= 0 && j+declaredSize <= len(content) {
+					chunk := content[j : j+declaredSize]
+					if repl, ok := lookup[fmt.Sprintf("%s\x00%d", relPath, i)]; ok {
+						chunk = repl
+					}
+					fmt.Fprintf(&b, "%s%d:%s", UnprintableReplacement, len(chunk), chunk)
+					i = j + declaredSize
+					continue
+				}
+			}
+		}
+		r, sz := utf8.DecodeRuneInString(content[i:])
+		if sz == 0 {
+			sz = 1
+		}
+		b.WriteRune(r)
+		i += sz
+	}
+	patched := b.String()
+	return patched, utf8.RuneCountInString(patched)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// TestMakeHTMLQRFallback checks that a QR fallback block is emitted for a
+// large unprintable-byte file and is tagged with its rel-path, and that the
+// textual representation is still present alongside it.
+func TestMakeHTMLQRFallback(t *testing.T) {
+	src := afero.NewMemMapFs()
+	afero.WriteFile(src, "root/blob.bin", bytes.Repeat([]byte{0xff}, 200), 0644)
+
+	var archive bytes.Buffer
+	if err := Encode(src, "root", &archive); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var html bytes.Buffer
+	r, w := io.Pipe()
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go makeHTMLWithOptions(&html, r, wg, HTMLOptions{QRFallback: true, QRThreshold: 32})
+	if _, err := io.Copy(w, &archive); err != nil {
+		t.Fatalf("writing archive to pipe: %v", err)
+	}
+	w.Close()
+	wg.Wait()
+
+	out := html.String()
+	if !strings.Contains(out, `class="qr-fallback"`) {
+		t.Fatalf("expected a QR fallback block in output, got:\n%s", out)
+	}
+	if !strings.Contains(out, `data-path="blob.bin"`) {
+		t.Fatalf("expected QR fallback tagged with blob.bin, got:\n%s", out)
+	}
+	if !strings.Contains(out, "base64:") {
+		t.Fatalf("expected the textual base64 representation to still be present, got:\n%s", out)
+	}
+}
+
+// TestDecodeScannedPDFPatchesMangledRun checks that decodeScannedPDF
+// substitutes a scanned QR payload for an OCR-mangled unprintable run and
+// still restores the file correctly.
+func TestDecodeScannedPDFPatchesMangledRun(t *testing.T) {
+	src := afero.NewMemMapFs()
+	data := append(bytes.Repeat([]byte("plain ascii text "), 20), bytes.Repeat([]byte{0x01, 0x02, 0x03}, 10)...)
+	afero.WriteFile(src, "root/blob.bin", data, 0644)
+
+	var archive bytes.Buffer
+	if err := Encode(src, "root", &archive); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	// Locate the unprintable-run marker's base64 payload and recover it
+	// exactly as an external QR scanner would, before corrupting the OCR
+	// text standing in for it. The offset is relative to the start of the
+	// file's content field, matching what renderQRBlocks tags a QR block
+	// with.
+	text := archive.String()
+	contentStart := strings.Index(text, "F,blob.bin,")
+	if contentStart == -1 {
+		t.Fatalf("expected an F record for blob.bin, got:\n%s", text)
+	}
+	for i, seen := contentStart+len("F,blob.bin,"), 0; seen < 5; i++ { // mode, length, timestamp, hash, runelen
+		if text[i] == ',' {
+			seen++
+			if seen == 5 {
+				contentStart = i + 1
+			}
+		}
+	}
+	content := text[contentStart:]
+
+	markerStart := strings.Index(content, UnprintableReplacement)
+	if markerStart == -1 {
+		t.Fatalf("expected an unprintable-run marker in content, got:\n%s", content)
+	}
+	colon := strings.Index(content[markerStart:], ":")
+	if colon == -1 {
+		t.Fatalf("malformed marker in content:\n%s", content)
+	}
+	colon += markerStart
+	sizeStr := content[markerStart+len(UnprintableReplacement) : colon]
+	size := 0
+	for _, c := range sizeStr {
+		size = size*10 + int(c-'0')
+	}
+	payloadStart := colon + 1
+	payload := content[payloadStart : payloadStart+size]
+
+	absPayloadStart := contentStart + payloadStart
+	mangled := text[:absPayloadStart] + strings.Repeat("?", size) + text[absPayloadStart+size:]
+
+	qrPayloads := []ScannedQRPayload{{Path: "blob.bin", Offset: markerStart, Base64: payload}}
+
+	dst := afero.NewMemMapFs()
+	if err := decodeScannedPDF(strings.NewReader(mangled), qrPayloads, &dirSink{fs: dst, baseDir: "out"}); err != nil {
+		t.Fatalf("decodeScannedPDF: %v", err)
+	}
+
+	got, err := afero.ReadFile(dst, "out/blob.bin")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("blob.bin = %v, %v", got, err)
+	}
+}
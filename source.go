@@ -0,0 +1,195 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Source abstracts where Encode reads its directory/file tree from. Walk
+// calls fn once for every directory and file, in the order they should be
+// recorded; data is nil for directories.
+type Source interface {
+	Walk(fn func(path string, mode os.FileMode, mtime time.Time, data []byte) error) error
+}
+
+// Sink abstracts where Decode restores its directory/file tree to. Put is
+// called once per directory or file recorded in the archive, in stream
+// order; data is nil for directories. Close finalizes the sink (e.g.
+// flushing a zip writer) and is always called once, even if Put returned
+// an earlier error.
+type Sink interface {
+	Put(path string, mode os.FileMode, mtime time.Time, data []byte) error
+	Close() error
+}
+
+// dirSource walks a real (or in-memory) directory tree through afero.
+type dirSource struct {
+	fs   afero.Fs
+	root string
+}
+
+func (s *dirSource) Walk(fn func(path string, mode os.FileMode, mtime time.Time, data []byte) error) error {
+	return afero.Walk(s.fs, s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(s.root, path)
+		if info.IsDir() {
+			if relPath == "." {
+				return nil
+			}
+			return fn(relPath, info.Mode(), info.ModTime(), nil)
+		}
+		data, err := afero.ReadFile(s.fs, path)
+		if err != nil {
+			return err
+		}
+		return fn(relPath, info.Mode(), info.ModTime(), data)
+	})
+}
+
+// zipSource walks the entries of an already-open zip archive, so a printed
+// PDF of a zipped project can be archived without unpacking it first.
+type zipSource struct {
+	zr *zip.Reader
+}
+
+// zipImplicitDirMode is the mode recorded for an ancestor directory that
+// zipSource.Walk synthesizes because the zip has no explicit entry for it
+// (the common case: most zip writers only emit entries for the files they
+// were given, e.g. the repo's own writeTestZip helper).
+const zipImplicitDirMode = os.FileMode(0755)
+
+func (s *zipSource) Walk(fn func(path string, mode os.FileMode, mtime time.Time, data []byte) error) error {
+	seenDirs := make(map[string]bool)
+	var emitAncestors func(name string) error
+	emitAncestors = func(name string) error {
+		dir := path.Dir(name)
+		if dir == "." || dir == "/" || seenDirs[dir] {
+			return nil
+		}
+		if err := emitAncestors(dir); err != nil {
+			return err
+		}
+		seenDirs[dir] = true
+		return fn(dir, os.ModeDir|zipImplicitDirMode, time.Time{}, nil)
+	}
+
+	for _, f := range s.zr.File {
+		info := f.FileInfo()
+		name := strings.TrimSuffix(f.Name, "/")
+		if err := emitAncestors(name); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if seenDirs[name] {
+				continue
+			}
+			seenDirs[name] = true
+			if err := fn(name, info.Mode(), f.Modified, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("opening zip entry %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("reading zip entry %s: %v", f.Name, err)
+		}
+		if err := fn(name, info.Mode(), f.Modified, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirSink restores entries as loose files and directories through afero.
+type dirSink struct {
+	fs      afero.Fs
+	baseDir string
+}
+
+func (s *dirSink) Put(path string, mode os.FileMode, mtime time.Time, data []byte) error {
+	full := filepath.Join(s.baseDir, path)
+	if mode.IsDir() {
+		return s.fs.MkdirAll(full, mode.Perm())
+	}
+	f, err := s.fs.Create(full)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := s.fs.Chmod(full, mode.Perm()); err != nil {
+		return err
+	}
+	return s.fs.Chtimes(full, mtime, mtime)
+}
+
+func (s *dirSink) Close() error { return nil }
+
+// zipSink restores entries into a single .zip stream instead of loose
+// files, so a printed PDF can be round-tripped back into a distributable
+// archive without needing a scratch directory.
+type zipSink struct {
+	zw *zip.Writer
+}
+
+func (s *zipSink) Put(path string, mode os.FileMode, mtime time.Time, data []byte) error {
+	if mode.IsDir() {
+		name := path
+		if !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		hdr := &zip.FileHeader{Name: name, Modified: mtime}
+		hdr.SetMode(mode | os.ModeDir)
+		_, err := s.zw.CreateHeader(hdr)
+		return err
+	}
+	hdr := &zip.FileHeader{Name: path, Method: zip.Deflate, Modified: mtime}
+	hdr.SetMode(mode)
+	w, err := s.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (s *zipSink) Close() error { return s.zw.Close() }
+
+// EncodeZip walks the entries of the zip archive at zipPath and writes the
+// text-archive encoding of its contents to w, the same as Encode does for a
+// real directory.
+func EncodeZip(zipPath string, w io.Writer) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("opening zip %s: %v", zipPath, err)
+	}
+	defer zr.Close()
+	return encodeFromSource(&zipSource{zr: &zr.Reader}, w)
+}
+
+// DecodeZip reads an encoded archive from r and writes its contents as a
+// .zip stream to w instead of restoring loose files, so a scanned PDF can
+// be round-tripped back into a single distributable archive.
+func DecodeZip(r io.Reader, w io.Writer) error {
+	return decodeToSink(r, &zipSink{zw: zip.NewWriter(w)})
+}
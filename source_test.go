@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func writeTestZip(t *testing.T, path string) {
+	t.Helper()
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	w, err := zw.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello zip")); err != nil {
+		t.Fatal(err)
+	}
+	w, err = zw.Create("dir/b.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{0, 1, 2, 255}); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestZipImplicitDirsRestoreToRealFs checks that a zip with no explicit
+// entries for its intermediate directories (the common case — most zip
+// writers, including writeTestZip above, only emit entries for the files
+// they were given) still restores cleanly onto a real filesystem. zipSource
+// must synthesize the missing "nested" and "nested/deep" directory records
+// so dirSink.Put's MkdirAll-free file restore has somewhere to write.
+func TestZipImplicitDirsRestoreToRealFs(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "in.zip")
+	out, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	w, err := zw.Create("nested/deep/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello nested")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if err := EncodeZip(zipPath, &archive); err != nil {
+		t.Fatalf("EncodeZip: %v", err)
+	}
+
+	destDir := t.TempDir()
+	if err := Decode(&archive, afero.NewOsFs(), destDir); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(destDir, "nested/deep/a.txt"))
+	if err != nil || string(got) != "hello nested" {
+		t.Fatalf("nested/deep/a.txt = %q, %v", got, err)
+	}
+}
+
+func TestZipRoundTrip(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "in.zip")
+	writeTestZip(t, zipPath)
+
+	var archive bytes.Buffer
+	if err := EncodeZip(zipPath, &archive); err != nil {
+		t.Fatalf("EncodeZip: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := DecodeZip(&archive, &out); err != nil {
+		t.Fatalf("DecodeZip: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("reading produced zip: %v", err)
+	}
+	want := map[string][]byte{
+		"a.txt":     []byte("hello zip"),
+		"dir/b.bin": {0, 1, 2, 255},
+	}
+	got := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		got[f.Name] = data
+	}
+	for name, wantData := range want {
+		gotData, ok := got[name]
+		if !ok {
+			t.Errorf("missing entry %s in round-tripped zip", name)
+			continue
+		}
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("%s = %v, want %v", name, gotData, wantData)
+		}
+	}
+}
+
+// TestDecodeZipClosesOnScanError checks that DecodeZip still finalizes the
+// zip.Writer when the archive stream errors out partway through (here, a
+// dangling "F" record with no metadata behind it), so the entries decoded
+// before the error are still readable instead of a 0-byte stream
+// zip.NewReader rejects outright.
+func TestDecodeZipClosesOnScanError(t *testing.T) {
+	src := afero.NewMemMapFs()
+	afero.WriteFile(src, "root/a.txt", []byte("hello"), 0644)
+	afero.WriteFile(src, "root/b.txt", []byte("world"), 0644)
+
+	var archive bytes.Buffer
+	if err := Encode(src, "root", &archive); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	s := archive.String()
+	idx := strings.Index(s, "M,")
+	if idx == -1 {
+		t.Fatalf("expected a manifest trailer in:\n%s", s)
+	}
+	truncated := s[:idx] + "F,bad,"
+
+	var out bytes.Buffer
+	if err := DecodeZip(strings.NewReader(truncated), &out); err == nil {
+		t.Fatal("expected an error for a truncated archive")
+	}
+	if out.Len() == 0 {
+		t.Fatal("expected DecodeZip to flush the zip.Writer for the entries it did decode, got 0 bytes")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("reading produced zip: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("expected both files decoded before the error to survive, got %d entries", len(zr.File))
+	}
+}